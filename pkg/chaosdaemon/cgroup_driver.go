@@ -0,0 +1,150 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosdaemon
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	cgroupfsDriverName = "cgroupfs"
+	systemdDriverName  = "systemd"
+)
+
+// CgroupDriver selects how the container runtime lays out cgroup paths on
+// this node: "cgroupfs" paths (e.g. /kubepods/burstable/pod<uid>/<container>)
+// are used verbatim, while "systemd" paths are slice/scope unit names (e.g.
+// /kubepods.slice/.../cri-containerd-<id>.scope) that have to be walked
+// differently to find the pod's enclosing cgroup. Left empty, it is
+// auto-detected via detectCgroupDriver.
+//
+// NOTE: ExecPodStressors is the only caller of cgroupDriverFor in this tree;
+// it uses the driver to derive the pod cgroup for StressRequest_POD.
+// CancelPodStressors does no cgroup discovery of its own.
+var CgroupDriver string
+
+func init() {
+	flag.StringVar(&CgroupDriver, "cgroup-driver", "",
+		`cgroup driver in use on this node: "cgroupfs" or "systemd"; auto-detected from /sys/fs/cgroup when empty`)
+}
+
+// cgroupDriverFor returns the driver implementation for name, auto-detecting
+// the node's driver first if name is empty.
+func cgroupDriverFor(name string) cgroupDriver {
+	if name == "" {
+		name = detectCgroupDriver()
+	}
+	if name == systemdDriverName {
+		return systemdDriver{}
+	}
+	return cgroupfsDriver{}
+}
+
+// cgroupDriver knows how to derive the pod-scoped cgroup path from a
+// container's cgroup path, which differs between the cgroupfs and systemd
+// cgroup drivers.
+type cgroupDriver interface {
+	// podPath returns the cgroup path of the pod that owns containerPath.
+	podPath(containerPath string) string
+}
+
+// cgroupfsDriver handles the plain, nested-directory cgroupfs layout used
+// when the container runtime and kubelet are both configured with
+// --cgroup-driver=cgroupfs: the pod's cgroup is simply the parent directory
+// of the container's.
+type cgroupfsDriver struct{}
+
+func (cgroupfsDriver) podPath(containerPath string) string {
+	dir, _ := filepath.Split(containerPath)
+	return dir
+}
+
+// systemdDriver handles the slice/scope layout used when the container
+// runtime is configured with --cgroup-driver=systemd. Containers live in a
+// ".scope" unit nested under a chain of ".slice" units, and the pod's cgroup
+// is the nearest enclosing "*-pod<uid>.slice", which isn't always the
+// immediate parent directory (some runtimes add an extra QoS-class slice
+// between the pod slice and the container scope).
+type systemdDriver struct{}
+
+func (systemdDriver) podPath(containerPath string) string {
+	segments := strings.Split(strings.TrimSuffix(containerPath, "/"), "/")
+	for i, seg := range segments {
+		if !isPodSlice(seg) {
+			continue
+		}
+		// The pod slice's ancestry should follow systemd's "-" escaping
+		// convention, e.g. "kubepods-burstable-pod123.slice" nested under
+		// "kubepods.slice/kubepods-burstable.slice". Some runtimes flatten
+		// that into a single directory instead of nesting it on disk, so
+		// reconstruct the canonical path from the unit name rather than
+		// trusting whatever ancestry happens to be literally on disk.
+		found := strings.Join(segments[:i+1], "/")
+		if canonical := unescapeSystemdSlice(seg); canonical != found {
+			return canonical + "/"
+		}
+		return found + "/"
+	}
+	parent, _ := filepath.Split(containerPath)
+	return parent
+}
+
+// isPodSlice reports whether unit is the systemd slice unit that scopes a
+// whole pod, e.g. "kubepods-burstable-pod123abc.slice".
+func isPodSlice(unit string) bool {
+	return strings.HasSuffix(unit, ".slice") && strings.Contains(unit, "-pod")
+}
+
+// unescapeSystemdSlice decodes a systemd slice unit name into the nested
+// cgroupfs path it corresponds to, following systemd's "-" escaping
+// convention for slice names: each "-"-separated prefix of the unit name is
+// itself a parent slice. For example "kubepods-burstable.slice" decodes to
+// "/kubepods.slice/kubepods-burstable.slice".
+func unescapeSystemdSlice(unit string) string {
+	name := strings.TrimSuffix(unit, ".slice")
+	segments := strings.Split(name, "-")
+	var path, acc strings.Builder
+	for i, seg := range segments {
+		if i > 0 {
+			acc.WriteString("-")
+		}
+		acc.WriteString(seg)
+		path.WriteString("/" + acc.String() + ".slice")
+	}
+	return path.String()
+}
+
+// detectCgroupDriver probes the node for the cgroup driver in use, mirroring
+// how kubelet infers it from the container runtime: the systemd driver
+// always roots cgroups under a "*.slice" unit, so a literal "kubepods" or
+// "kubepods.slice" top-level directory tells them apart. On cgroup v2 that
+// directory lives straight under the unified mountpoint; on v1 there is no
+// single root, so the same check is made under the cpu controller's own
+// mount instead.
+func detectCgroupDriver() string {
+	root := unifiedMountpoint
+	if unified, err := isUnifiedCgroupHierarchy(); err == nil && !unified {
+		root = filepath.Join(cgroupV1Root, "cpu")
+	}
+	if _, err := os.Stat(filepath.Join(root, "kubepods.slice")); err == nil {
+		return systemdDriverName
+	}
+	if _, err := os.Stat(filepath.Join(root, "kubepods")); err == nil {
+		return cgroupfsDriverName
+	}
+	return cgroupfsDriverName
+}
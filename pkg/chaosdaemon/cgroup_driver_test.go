@@ -0,0 +1,62 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosdaemon
+
+import "testing"
+
+func TestCgroupfsDriverPodPath(t *testing.T) {
+	got := cgroupfsDriver{}.podPath("/kubepods/burstable/pod123/container456")
+	want := "/kubepods/burstable/pod123/"
+	if got != want {
+		t.Fatalf("podPath = %q, want %q", got, want)
+	}
+}
+
+func TestSystemdDriverPodPath(t *testing.T) {
+	got := systemdDriver{}.podPath("/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod123.slice/cri-containerd-456.scope")
+	want := "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod123.slice/"
+	if got != want {
+		t.Fatalf("podPath = %q, want %q", got, want)
+	}
+}
+
+func TestSystemdDriverPodPathWithNestedQoSSlice(t *testing.T) {
+	// some runtimes add an extra slice between the pod slice and the
+	// container scope; podPath must still find the enclosing pod slice.
+	got := systemdDriver{}.podPath("/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod123.slice/extra.slice/cri-containerd-456.scope")
+	want := "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod123.slice/"
+	if got != want {
+		t.Fatalf("podPath = %q, want %q", got, want)
+	}
+}
+
+func TestSystemdDriverPodPathFlatLayout(t *testing.T) {
+	// some runtimes put the pod slice directly under the cgroup root instead
+	// of nesting it under its ancestor slices; podPath should reconstruct the
+	// canonical nested path via unescapeSystemdSlice rather than trusting the
+	// flat layout on disk.
+	got := systemdDriver{}.podPath("/kubepods-burstable-pod123.slice/cri-containerd-456.scope")
+	want := "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod123.slice/"
+	if got != want {
+		t.Fatalf("podPath = %q, want %q", got, want)
+	}
+}
+
+func TestUnescapeSystemdSlice(t *testing.T) {
+	got := unescapeSystemdSlice("kubepods-burstable.slice")
+	want := "/kubepods.slice/kubepods-burstable.slice"
+	if got != want {
+		t.Fatalf("unescapeSystemdSlice = %q, want %q", got, want)
+	}
+}
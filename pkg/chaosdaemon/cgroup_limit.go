@@ -0,0 +1,218 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosdaemon
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/containerd/cgroups"
+	"github.com/containerd/cgroups/v2/cgroup2"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+
+	pb "github.com/pingcap/chaos-mesh/pkg/chaosdaemon/pb"
+)
+
+const (
+	// cgroupV1Root is the standard per-controller cgroupfs mountpoint layout
+	// used when running the cgroup v1 hierarchy, e.g. /sys/fs/cgroup/cpu.
+	cgroupV1Root = "/sys/fs/cgroup"
+
+	// defaultCfsPeriodUs is the CFS bandwidth period (100ms) used to turn a
+	// requested CPU percentage into a cfs_quota_us value.
+	defaultCfsPeriodUs = int64(100000)
+)
+
+// applyCgroupLimit throttles the target cgroup's CPU and/or memory directly
+// through its controllers, the way runc/libcontainer does, instead of
+// spawning a stress-ng busy-loop process. Only the controllers the request
+// actually asks for are touched: a zero CpuQuota or MemoryLimit leaves that
+// controller's existing limit alone rather than writing an invalid quota of
+// 0 (rejected by the kernel) or a memory ceiling of 0 (which OOMs the
+// target). It returns a restore func that puts the original limits back. On
+// cgroup v1, cgroupPaths holds one path per subsystem (cpu and memory may
+// not coincide); on v2 the single unifiedCgroup path is used instead.
+func applyCgroupLimit(unifiedCgroup string, cgroupPaths map[cgroups.Name]string, unified bool, req *pb.StressRequest) (func() error, error) {
+	resources := &specs.LinuxResources{}
+
+	if req.CpuQuota > 0 {
+		period := uint64(defaultCfsPeriodUs)
+		quota := req.CpuQuota * defaultCfsPeriodUs / 100
+		resources.CPU = &specs.LinuxCPU{
+			Quota:  &quota,
+			Period: &period,
+		}
+	}
+
+	if req.MemoryLimit > 0 {
+		memLimit := int64(req.MemoryLimit)
+		resources.Memory = &specs.LinuxMemory{Limit: &memLimit}
+		if hasSwap() {
+			resources.Memory.Swap = &memLimit
+		}
+	}
+
+	if unified {
+		return applyCgroupLimitV2(unifiedCgroup, resources)
+	}
+	return applyCgroupLimitV1(cgroupPaths, resources)
+}
+
+func applyCgroupLimitV1(cgroupPaths map[cgroups.Name]string, resources *specs.LinuxResources) (func() error, error) {
+	original, err := readCgroupV1Resources(cgroupPaths)
+	if err != nil {
+		return nil, err
+	}
+	control, err := cgroups.Load(cgroups.V1, cgroupPathFromMap(cgroupPaths))
+	if err != nil {
+		return nil, err
+	}
+	if err := control.Update(resources); err != nil {
+		return nil, err
+	}
+	return func() error {
+		control, err := cgroups.Load(cgroups.V1, cgroupPathFromMap(cgroupPaths))
+		if err != nil {
+			return err
+		}
+		return control.Update(original)
+	}, nil
+}
+
+func applyCgroupLimitV2(cgroup string, resources *specs.LinuxResources) (func() error, error) {
+	original, err := readCgroupV2Resources(cgroup)
+	if err != nil {
+		return nil, err
+	}
+	manager, err := cgroup2.LoadManager(unifiedMountpoint, cgroup)
+	if err != nil {
+		return nil, err
+	}
+	if err := manager.Update(cgroup2.ToResources(resources)); err != nil {
+		return nil, err
+	}
+	return func() error {
+		manager, err := cgroup2.LoadManager(unifiedMountpoint, cgroup)
+		if err != nil {
+			return err
+		}
+		return manager.Update(cgroup2.ToResources(original))
+	}, nil
+}
+
+// readCgroupV1Resources snapshots the CPU and memory limits currently in
+// effect for the cgroups in cgroupPaths so they can be restored once the
+// stressor is cancelled. cpu and memory are read from their own paths since
+// they aren't guaranteed to be co-mounted at the same one.
+func readCgroupV1Resources(cgroupPaths map[cgroups.Name]string) (*specs.LinuxResources, error) {
+	cpuPath, ok := cgroupPaths["cpu"]
+	if !ok {
+		return nil, cgroups.ErrControllerNotActive
+	}
+	memPath, ok := cgroupPaths["memory"]
+	if !ok {
+		return nil, cgroups.ErrControllerNotActive
+	}
+
+	quota, err := readInt64(filepath.Join(cgroupV1Root, "cpu", cpuPath, "cpu.cfs_quota_us"))
+	if err != nil {
+		return nil, err
+	}
+	period, err := readInt64(filepath.Join(cgroupV1Root, "cpu", cpuPath, "cpu.cfs_period_us"))
+	if err != nil {
+		return nil, err
+	}
+	limit, err := readInt64(filepath.Join(cgroupV1Root, "memory", memPath, "memory.limit_in_bytes"))
+	if err != nil {
+		return nil, err
+	}
+	periodU64 := uint64(period)
+	resources := &specs.LinuxResources{
+		CPU:    &specs.LinuxCPU{Quota: &quota, Period: &periodU64},
+		Memory: &specs.LinuxMemory{Limit: &limit},
+	}
+	if hasSwap() {
+		memsw, err := readInt64(filepath.Join(cgroupV1Root, "memory", memPath, "memory.memsw.limit_in_bytes"))
+		if err == nil {
+			resources.Memory.Swap = &memsw
+		}
+	}
+	return resources, nil
+}
+
+// readCgroupV2Resources is the cgroup v2 analogue of readCgroupV1Resources,
+// reading the unified "cpu.max" and "memory.max" files.
+func readCgroupV2Resources(cgroup string) (*specs.LinuxResources, error) {
+	cpuMax, err := readCgroupFile(filepath.Join(unifiedMountpoint, cgroup, "cpu.max"))
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(cpuMax)
+	if len(fields) != 2 {
+		return nil, errors.Errorf("unexpected cpu.max contents: %q", cpuMax)
+	}
+	period, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	var quota int64 = -1
+	if fields[0] != "max" {
+		quota, err = strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+	}
+	limit, err := readInt64(filepath.Join(unifiedMountpoint, cgroup, "memory.max"))
+	if err != nil {
+		return nil, err
+	}
+	return &specs.LinuxResources{
+		CPU:    &specs.LinuxCPU{Quota: &quota, Period: &period},
+		Memory: &specs.LinuxMemory{Limit: &limit},
+	}, nil
+}
+
+// hasSwap reports whether the host has any swap configured, mirroring
+// kubelet's cgroup v1 swap guard: without it, writing memory.memsw.limit_in_bytes
+// fails outright on swap-less hosts.
+func hasSwap() bool {
+	b, err := os.ReadFile("/proc/swaps")
+	if err != nil {
+		return false
+	}
+	// the first line is a header; any further line means swap is configured.
+	return len(strings.Split(strings.TrimSpace(string(b)), "\n")) > 1
+}
+
+func readCgroupFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func readInt64(path string) (int64, error) {
+	s, err := readCgroupFile(path)
+	if err != nil {
+		return 0, err
+	}
+	if s == "max" {
+		return -1, nil
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
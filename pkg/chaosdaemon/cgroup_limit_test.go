@@ -0,0 +1,50 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosdaemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadInt64(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "cpu.cfs_quota_us")
+	if err := os.WriteFile(p, []byte("50000\n"), 0644); err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+	got, err := readInt64(p)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 50000 {
+		t.Fatalf("readInt64 = %d, want 50000", got)
+	}
+}
+
+func TestReadInt64Unlimited(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "cpu.max")
+	if err := os.WriteFile(p, []byte("max\n"), 0644); err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+	got, err := readInt64(p)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != -1 {
+		t.Fatalf("readInt64 = %d, want -1 for an unlimited v2 value", got)
+	}
+}
@@ -0,0 +1,135 @@
+// Package pb holds the wire types for the chaosDaemon gRPC service defined
+// in stressd.proto. It is hand-maintained rather than protoc-generated (this
+// tree has no protoc/protoc-gen-go available), so it only carries the
+// StressRequest message types the daemon actually needs; it does not include
+// a file descriptor or the chaosDaemon client/server stubs that a real
+// `protoc --go_out` run would emit. Keep this in sync with stressd.proto by
+// hand until protoc generation is wired up.
+package pb
+
+import (
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type StressRequest_Scope int32
+
+const (
+	StressRequest_CONTAINER StressRequest_Scope = 0
+	StressRequest_POD       StressRequest_Scope = 1
+)
+
+var StressRequest_Scope_name = map[int32]string{
+	0: "CONTAINER",
+	1: "POD",
+}
+
+var StressRequest_Scope_value = map[string]int32{
+	"CONTAINER": 0,
+	"POD":       1,
+}
+
+func (x StressRequest_Scope) String() string {
+	return proto.EnumName(StressRequest_Scope_name, int32(x))
+}
+
+// Mode selects how the stressors are applied: STRESS_NG shells out to the
+// stress-ng binary (the original behavior); CGROUP_LIMIT instead throttles
+// the target directly through its cgroup controllers.
+type StressRequest_Mode int32
+
+const (
+	StressRequest_STRESS_NG    StressRequest_Mode = 0
+	StressRequest_CGROUP_LIMIT StressRequest_Mode = 1
+)
+
+var StressRequest_Mode_name = map[int32]string{
+	0: "STRESS_NG",
+	1: "CGROUP_LIMIT",
+}
+
+var StressRequest_Mode_value = map[string]int32{
+	"STRESS_NG":    0,
+	"CGROUP_LIMIT": 1,
+}
+
+func (x StressRequest_Mode) String() string {
+	return proto.EnumName(StressRequest_Mode_name, int32(x))
+}
+
+type StressRequest struct {
+	Target    string             `protobuf:"bytes,1,opt,name=target,proto3" json:"target,omitempty"`
+	Stressors string             `protobuf:"bytes,2,opt,name=stressors,proto3" json:"stressors,omitempty"`
+	Scope     StressRequest_Scope `protobuf:"varint,3,opt,name=scope,proto3,enum=pb.StressRequest_Scope" json:"scope,omitempty"`
+	Mode      StressRequest_Mode  `protobuf:"varint,4,opt,name=mode,proto3,enum=pb.StressRequest_Mode" json:"mode,omitempty"`
+
+	// cpu_quota is the CPU percentage (0-100 per core) to throttle the target
+	// to in CGROUP_LIMIT mode. Ignored in STRESS_NG mode.
+	CpuQuota int64 `protobuf:"varint,5,opt,name=cpu_quota,json=cpuQuota,proto3" json:"cpu_quota,omitempty"`
+
+	// memory_limit is the memory ceiling, in bytes, to apply to the target in
+	// CGROUP_LIMIT mode. Ignored in STRESS_NG mode.
+	MemoryLimit uint64 `protobuf:"varint,6,opt,name=memory_limit,json=memoryLimit,proto3" json:"memory_limit,omitempty"`
+
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *StressRequest) Reset()         { *m = StressRequest{} }
+func (m *StressRequest) String() string { return proto.CompactTextString(m) }
+func (*StressRequest) ProtoMessage()    {}
+
+func (m *StressRequest) GetTarget() string {
+	if m != nil {
+		return m.Target
+	}
+	return ""
+}
+
+func (m *StressRequest) GetStressors() string {
+	if m != nil {
+		return m.Stressors
+	}
+	return ""
+}
+
+func (m *StressRequest) GetScope() StressRequest_Scope {
+	if m != nil {
+		return m.Scope
+	}
+	return StressRequest_CONTAINER
+}
+
+func (m *StressRequest) GetMode() StressRequest_Mode {
+	if m != nil {
+		return m.Mode
+	}
+	return StressRequest_STRESS_NG
+}
+
+func (m *StressRequest) GetCpuQuota() int64 {
+	if m != nil {
+		return m.CpuQuota
+	}
+	return 0
+}
+
+func (m *StressRequest) GetMemoryLimit() uint64 {
+	if m != nil {
+		return m.MemoryLimit
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterEnum("pb.StressRequest_Scope", StressRequest_Scope_name, StressRequest_Scope_value)
+	proto.RegisterEnum("pb.StressRequest_Mode", StressRequest_Mode_name, StressRequest_Mode_value)
+	proto.RegisterType((*StressRequest)(nil), "pb.StressRequest")
+}
@@ -26,6 +26,7 @@ import (
 	"syscall"
 
 	"github.com/containerd/cgroups"
+	"github.com/containerd/cgroups/v2/cgroup2"
 	"github.com/golang/protobuf/ptypes/empty"
 	"github.com/pkg/errors"
 
@@ -34,7 +35,7 @@ import (
 
 var (
 	stressorLocker = new(sync.Mutex)
-	podStressors   = make(map[string]*exec.Cmd)
+	podStressors   = make(map[string]*stressor)
 
 	// Possible cgroup subsystems
 	cgroupSubsys = []string{"cpu", "memory", "systemd", "net_cls",
@@ -42,6 +43,44 @@ var (
 		"cpuset", "cpuacct", "pids", "hugetlb"}
 )
 
+const (
+	// unifiedMountpoint is where Kubernetes and most distros mount the
+	// cgroup v2 unified hierarchy.
+	unifiedMountpoint = "/sys/fs/cgroup"
+
+	// cgroup2SuperMagic is the filesystem magic number for cgroup2, as
+	// returned by statfs(2). See linux/magic.h.
+	cgroup2SuperMagic = 0x63677270
+
+	// cgroupV2UnifiedName is the sentinel key `parseCgroupFromReader` stores
+	// the unified `0::<path>` entry under, since that entry has no
+	// controller name to key off of. `getCgroupDestination` special-cases it
+	// (matching the cgroup2 mount by filesystem type), so `existingPath` can
+	// serve both cgroup v1 and v2 from the same map.
+	cgroupV2UnifiedName = "__unified__"
+)
+
+// isUnifiedCgroupHierarchy reports whether the host is running the cgroup v2
+// unified hierarchy. It mirrors kubelet's isCgroup2UnifiedMode: statfs the
+// standard cgroup mountpoint and compare the filesystem magic number.
+func isUnifiedCgroupHierarchy() (bool, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(unifiedMountpoint, &st); err != nil {
+		return false, errors.Wrapf(err, "statfs %s", unifiedMountpoint)
+	}
+	return int64(st.Type) == cgroup2SuperMagic, nil
+}
+
+// stressor tracks a running stress injection so CancelPodStressors can tear
+// it down again, regardless of which StressRequest_Mode created it.
+type stressor struct {
+	// cmd is set when the stressor was created in STRESS_NG mode.
+	cmd *exec.Cmd
+	// restore is set when the stressor was created in CGROUP_LIMIT mode; it
+	// puts the cgroup's original resource limits back.
+	restore func() error
+}
+
 func (s *daemonServer) ExecPodStressors(ctx context.Context,
 	req *pb.StressRequest) (*empty.Empty, error) {
 	log.Info("executing stressors", "request", req)
@@ -54,29 +93,80 @@ func (s *daemonServer) ExecPodStressors(ctx context.Context,
 	if err != nil {
 		return nil, err
 	}
-	cgroup, err := findValidCgroup(path, id)
+
+	unified, err := isUnifiedCgroupHierarchy()
 	if err != nil {
 		return nil, err
 	}
-	if req.Scope == pb.StressRequest_POD {
-		cgroup, _ = filepath.Split(cgroup)
+
+	driver := cgroupDriverFor(CgroupDriver)
+
+	// On cgroup v2 there is a single unified path; on v1 the container can
+	// be split across several co-mounted controllers that don't share a
+	// path, so we track one path per subsystem.
+	var unifiedCgroup string
+	var cgroupPaths map[cgroups.Name]string
+	if unified {
+		unifiedCgroup, err = findValidCgroup(path, id, true)
+		if err != nil {
+			return nil, err
+		}
+		if req.Scope == pb.StressRequest_POD {
+			unifiedCgroup = driver.podPath(unifiedCgroup)
+		}
+	} else {
+		cgroupPaths, err = findCgroupPaths(path, id)
+		if err != nil {
+			return nil, err
+		}
+		if req.Scope == pb.StressRequest_POD {
+			for name, p := range cgroupPaths {
+				cgroupPaths[name] = driver.podPath(p)
+			}
+		}
 	}
-	control, err := cgroups.Load(cgroups.V1, cgroups.StaticPath(cgroup))
-	if err != nil {
-		return nil, err
+
+	if req.Mode == pb.StressRequest_CGROUP_LIMIT {
+		restore, err := applyCgroupLimit(unifiedCgroup, cgroupPaths, unified, req)
+		if err != nil {
+			return nil, err
+		}
+		stressorLocker.Lock()
+		defer stressorLocker.Unlock()
+		podStressors[req.Target] = &stressor{restore: restore}
+		return &empty.Empty{}, nil
 	}
+
 	cmd := exec.Command("stress-ng", strings.Fields(req.Stressors)...)
 	if err := cmd.Start(); err != nil {
 		return nil, err
 	}
-	if err = control.Add(cgroups.Process{Pid: cmd.Process.Pid}); err != nil {
-		if err := cmd.Process.Kill(); err != nil {
+
+	if unified {
+		manager, err := cgroup2.LoadManager(unifiedMountpoint, unifiedCgroup)
+		if err != nil {
 			return nil, err
 		}
+		if err = manager.AddProc(uint64(cmd.Process.Pid)); err != nil {
+			if err := cmd.Process.Kill(); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		control, err := cgroups.Load(cgroups.V1, cgroupPathFromMap(cgroupPaths))
+		if err != nil {
+			return nil, err
+		}
+		if err = control.Add(cgroups.Process{Pid: cmd.Process.Pid}); err != nil {
+			if err := cmd.Process.Kill(); err != nil {
+				return nil, err
+			}
+		}
 	}
+
 	stressorLocker.Lock()
 	defer stressorLocker.Unlock()
-	podStressors[req.Target] = cmd
+	podStressors[req.Target] = &stressor{cmd: cmd}
 	go func() {
 		if err, ok := cmd.Wait().(*exec.ExitError); ok {
 			status := err.Sys().(syscall.WaitStatus)
@@ -97,25 +187,88 @@ func (s *daemonServer) ExecPodStressors(ctx context.Context,
 func (s *daemonServer) CancelPodStressors(ctx context.Context,
 	req *pb.StressRequest) (*empty.Empty, error) {
 	log.Info("canceling stressors", "request", req)
-	if cmd, ok := podStressors[req.Target]; ok {
-		if err := cmd.Process.Kill(); err != nil {
-			log.Error(err, "fail to exit stressors", "pid", cmd.Process.Pid)
-			return nil, err
+	if st, ok := podStressors[req.Target]; ok {
+		if st.cmd != nil {
+			// stress-ng forks a tree of worker processes that are added to
+			// the victim container/pod's own cgroup (there's no dedicated
+			// sub-cgroup to scope to), so cancellation has to kill exactly
+			// the stress-ng process tree rather than anything sharing that
+			// cgroup -- otherwise it takes the victim's real workload down
+			// with it.
+			if err := killStressorTree(st, cancelKillTimeout); err != nil {
+				log.Error(err, "fail to exit stressors", "pid", st.cmd.Process.Pid)
+				return nil, err
+			}
+		}
+		if st.restore != nil {
+			if err := st.restore(); err != nil {
+				log.Error(err, "fail to restore cgroup limits", "target", req.Target)
+				return nil, err
+			}
+			stressorLocker.Lock()
+			delete(podStressors, req.Target)
+			stressorLocker.Unlock()
 		}
 	}
 	return &empty.Empty{}, nil
 }
 
-func findValidCgroup(path cgroups.Path, target string) (string, error) {
+func findValidCgroup(path cgroups.Path, target string, unified bool) (string, error) {
+	if unified {
+		p, err := path(cgroups.Name(cgroupV2UnifiedName))
+		if err != nil {
+			return "", err
+		}
+		if !strings.Contains(p, target) {
+			return "", fmt.Errorf("never found valid cgroup for %s", target)
+		}
+		return p, nil
+	}
 	for _, subsys := range cgroupSubsys {
-		if p, _ := path(cgroups.Name(subsys));
-			strings.Contains(p, target) {
+		if p, _ := path(cgroups.Name(subsys)); strings.Contains(p, target) {
 			return p, nil
 		}
 	}
 	return "", fmt.Errorf("never found valid cgroup for %s", target)
 }
 
+// findCgroupPaths builds the full set of cgroup v1 paths for the container
+// identified by target, one per mounted subsystem, mirroring how
+// containerd/cgroups' own PidPath constructs one. A single path is not
+// always enough: some hosts only co-mount a subset of controllers together
+// (e.g. cpu,cpuacct), so cpu and memory can live at different paths.
+func findCgroupPaths(path cgroups.Path, target string) (map[cgroups.Name]string, error) {
+	paths := make(map[cgroups.Name]string)
+	for _, subsys := range cgroupSubsys {
+		p, err := path(cgroups.Name(subsys))
+		if err != nil {
+			continue
+		}
+		if strings.Contains(p, target) {
+			paths[cgroups.Name(subsys)] = p
+		}
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("never found valid cgroup for %s", target)
+	}
+	return paths, nil
+}
+
+// cgroupPathFromMap turns a pre-resolved per-subsystem path map into a
+// cgroups.Path closure. It reports ErrControllerNotActive for subsystems
+// missing from the map so cgroups.Load can still succeed against the rest,
+// the same lenient behavior containerd/cgroups' own loaders use for hosts
+// that don't mount every controller.
+func cgroupPathFromMap(paths map[cgroups.Name]string) cgroups.Path {
+	return func(name cgroups.Name) (string, error) {
+		p, ok := paths[name]
+		if !ok {
+			return "", cgroups.ErrControllerNotActive
+		}
+		return p, nil
+	}
+}
+
 // PidPath will return the correct cgroup paths for an existing process running inside a cgroup
 // This is commonly used for the Load function to restore an existing container.
 //
@@ -191,6 +344,13 @@ func parseCgroupFromReader(r io.Reader) (map[string]string, error) {
 		if len(parts) < 3 {
 			return nil, fmt.Errorf("invalid cgroup entry: %q", text)
 		}
+		// On cgroup v2 hosts the controller list is empty and the line looks
+		// like "0::/path" -- there is a single unified hierarchy, so stash it
+		// under a sentinel key instead of one per controller.
+		if parts[0] == "0" && parts[1] == "" {
+			cgroups[cgroupV2UnifiedName] = parts[2]
+			continue
+		}
 		for _, subs := range strings.Split(parts[1], ",") {
 			if subs != "" {
 				cgroups[subs] = parts[2]
@@ -214,6 +374,14 @@ func getCgroupDestination(pid int, subsystem string) (string, error) {
 			return "", err
 		}
 		fields := strings.Fields(s.Text())
+		// the unified hierarchy has no per-controller super option to match
+		// on, so key off the filesystem type instead.
+		if subsystem == cgroupV2UnifiedName {
+			if mountinfoFsType(fields) == "cgroup2" {
+				return fields[3], nil
+			}
+			continue
+		}
 		for _, opt := range strings.Split(fields[len(fields)-1], ",") {
 			if opt == subsystem {
 				return fields[3], nil
@@ -222,3 +390,14 @@ func getCgroupDestination(pid int, subsystem string) (string, error) {
 	}
 	return "", fmt.Errorf("never found desct for %s", subsystem)
 }
+
+// mountinfoFsType returns the filesystem type field of a /proc/<pid>/mountinfo
+// line, i.e. the field right after the "-" separator.
+func mountinfoFsType(fields []string) string {
+	for i, f := range fields {
+		if f == "-" && i+1 < len(fields) {
+			return fields[i+1]
+		}
+	}
+	return ""
+}
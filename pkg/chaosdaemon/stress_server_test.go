@@ -0,0 +1,157 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosdaemon
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/containerd/cgroups"
+)
+
+// cgroupV1Fixture is a canned /proc/<pid>/cgroup for a host running the
+// cgroupfs-backed cgroup v1 hierarchy.
+const cgroupV1Fixture = `11:memory:/kubepods/burstable/pod123/container456
+10:cpu,cpuacct:/kubepods/burstable/pod123/container456
+9:devices:/kubepods/burstable/pod123/container456
+`
+
+// cgroupV2Fixture is a canned /proc/<pid>/cgroup for a host running the
+// cgroup v2 unified hierarchy: a single "0::<path>" line.
+const cgroupV2Fixture = `0::/kubepods/burstable/pod123/container456
+`
+
+func TestParseCgroupFromReaderV1(t *testing.T) {
+	paths, err := parseCgroupFromReader(strings.NewReader(cgroupV1Fixture))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if paths["memory"] != "/kubepods/burstable/pod123/container456" {
+		t.Fatalf("unexpected memory path: %q", paths["memory"])
+	}
+	if paths["cpu"] != "/kubepods/burstable/pod123/container456" {
+		t.Fatalf("unexpected cpu path: %q", paths["cpu"])
+	}
+	if _, ok := paths[cgroupV2UnifiedName]; ok {
+		t.Fatalf("did not expect a unified entry for a v1 fixture")
+	}
+}
+
+func TestParseCgroupFromReaderV2(t *testing.T) {
+	paths, err := parseCgroupFromReader(strings.NewReader(cgroupV2Fixture))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "/kubepods/burstable/pod123/container456"
+	if got := paths[cgroupV2UnifiedName]; got != want {
+		t.Fatalf("unified path = %q, want %q", got, want)
+	}
+}
+
+func TestFindValidCgroupV1(t *testing.T) {
+	paths, err := parseCgroupFromReader(strings.NewReader(cgroupV1Fixture))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	path := func(name cgroups.Name) (string, error) {
+		p, ok := paths[string(name)]
+		if !ok {
+			return "", cgroups.ErrControllerNotActive
+		}
+		return p, nil
+	}
+	got, err := findValidCgroup(path, "container456", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "/kubepods/burstable/pod123/container456" {
+		t.Fatalf("unexpected cgroup path: %q", got)
+	}
+}
+
+func TestFindValidCgroupV2(t *testing.T) {
+	paths, err := parseCgroupFromReader(strings.NewReader(cgroupV2Fixture))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	path := func(name cgroups.Name) (string, error) {
+		p, ok := paths[string(name)]
+		if !ok {
+			return "", cgroups.ErrControllerNotActive
+		}
+		return p, nil
+	}
+	got, err := findValidCgroup(path, "container456", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "/kubepods/burstable/pod123/container456" {
+		t.Fatalf("unexpected cgroup path: %q", got)
+	}
+}
+
+// cgroupV1MultiControllerFixture is a canned /proc/<pid>/cgroup where memory
+// and cpu are not co-mounted at the same path.
+const cgroupV1MultiControllerFixture = `11:memory:/kubepods/burstable/pod123/memory-container456
+10:cpu,cpuacct:/kubepods/burstable/pod123/container456
+9:devices:/kubepods/burstable/pod123/container456
+`
+
+func TestFindCgroupPaths(t *testing.T) {
+	paths, err := parseCgroupFromReader(strings.NewReader(cgroupV1MultiControllerFixture))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	path := func(name cgroups.Name) (string, error) {
+		p, ok := paths[string(name)]
+		if !ok {
+			return "", cgroups.ErrControllerNotActive
+		}
+		return p, nil
+	}
+
+	got, err := findCgroupPaths(path, "container456")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got["cpu"] != "/kubepods/burstable/pod123/container456" {
+		t.Fatalf("unexpected cpu path: %q", got["cpu"])
+	}
+	if got["memory"] != "/kubepods/burstable/pod123/memory-container456" {
+		t.Fatalf("unexpected memory path: %q", got["memory"])
+	}
+}
+
+func TestCgroupPathFromMapMissingController(t *testing.T) {
+	path := cgroupPathFromMap(map[cgroups.Name]string{"cpu": "/foo"})
+	if _, err := path("memory"); err != cgroups.ErrControllerNotActive {
+		t.Fatalf("expected ErrControllerNotActive, got %v", err)
+	}
+	p, err := path("cpu")
+	if err != nil || p != "/foo" {
+		t.Fatalf("path(cpu) = (%q, %v), want (/foo, nil)", p, err)
+	}
+}
+
+func TestMountinfoFsType(t *testing.T) {
+	v1Line := "25 30 0:22 / /sys/fs/cgroup/memory rw,nosuid shared:9 - cgroup cgroup rw,memory"
+	v2Line := "25 30 0:22 / /sys/fs/cgroup rw,nosuid shared:9 - cgroup2 cgroup2 rw"
+
+	if got := mountinfoFsType(strings.Fields(v1Line)); got != "cgroup" {
+		t.Fatalf("fs type = %q, want cgroup", got)
+	}
+	if got := mountinfoFsType(strings.Fields(v2Line)); got != "cgroup2" {
+		t.Fatalf("fs type = %q, want cgroup2", got)
+	}
+}
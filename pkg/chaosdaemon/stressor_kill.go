@@ -0,0 +1,99 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosdaemon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// cancelKillTimeout bounds how long CancelPodStressors waits for the
+	// stress-ng process tree to disappear after being killed, before giving
+	// up and reporting an error back through the RPC.
+	cancelKillTimeout = 5 * time.Second
+
+	killPollInterval = 100 * time.Millisecond
+)
+
+// killStressorTree stops every process stress-ng forked for st
+// deterministically. stress-ng is added directly into the victim
+// container/pod's own cgroup -- there is no dedicated sub-cgroup to scope
+// to -- so freezing or mass-killing that cgroup would take the workload it's
+// supposed to let recover down with it. Instead, walk the process tree
+// rooted at the stress-ng master pid, SIGKILL exactly those pids, and poll
+// until none of them are left.
+func killStressorTree(st *stressor, timeout time.Duration) error {
+	pids := processTree(st.cmd.Process.Pid)
+	for _, pid := range pids {
+		if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+			return errors.Wrapf(err, "kill pid %d", pid)
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		alive := alivePids(pids)
+		if len(alive) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("stressor workers %v did not exit within %s", alive, timeout)
+		}
+		time.Sleep(killPollInterval)
+	}
+}
+
+// processTree returns pid and every process forked from it, read from
+// /proc/<pid>/task/<tid>/children.
+func processTree(pid int) []int {
+	pids := []int{pid}
+	taskDir := fmt.Sprintf("/proc/%d/task", pid)
+	entries, err := os.ReadDir(taskDir)
+	if err != nil {
+		return pids
+	}
+	for _, e := range entries {
+		b, err := os.ReadFile(filepath.Join(taskDir, e.Name(), "children"))
+		if err != nil {
+			continue
+		}
+		for _, f := range strings.Fields(string(b)) {
+			child, err := strconv.Atoi(f)
+			if err != nil {
+				continue
+			}
+			pids = append(pids, processTree(child)...)
+		}
+	}
+	return pids
+}
+
+// alivePids filters pids down to the ones that still have a /proc entry.
+func alivePids(pids []int) []int {
+	var alive []int
+	for _, pid := range pids {
+		if _, err := os.Stat(fmt.Sprintf("/proc/%d", pid)); err == nil {
+			alive = append(alive, pid)
+		}
+	}
+	return alive
+}
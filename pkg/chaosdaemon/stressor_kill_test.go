@@ -0,0 +1,55 @@
+// Copyright 2020 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaosdaemon
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestAlivePidsFiltersExited(t *testing.T) {
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("sleep not available: %v", err)
+	}
+	defer cmd.Process.Kill()
+
+	alive := alivePids([]int{cmd.Process.Pid})
+	if len(alive) != 1 || alive[0] != cmd.Process.Pid {
+		t.Fatalf("alivePids = %v, want [%d]", alive, cmd.Process.Pid)
+	}
+
+	if err := cmd.Process.Kill(); err != nil {
+		t.Fatalf("kill: %v", err)
+	}
+	cmd.Wait()
+
+	if got := alivePids([]int{cmd.Process.Pid}); len(got) != 0 {
+		t.Fatalf("alivePids = %v, want empty after kill", got)
+	}
+}
+
+func TestProcessTreeIncludesRoot(t *testing.T) {
+	pids := processTree(os.Getpid())
+	found := false
+	for _, pid := range pids {
+		if pid == os.Getpid() {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("processTree(%d) = %v, want it to include the root pid", os.Getpid(), pids)
+	}
+}